@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/phil-mansfield/shellfish/cmd"
+)
+
+var callServer string
+
+var callCmd = &cobra.Command{
+	Use:   "call <mode>",
+	Short: "Run a mode against a warm `shellfish serve` daemon instead of a cold process",
+	Long: `call speaks the same /v1/<mode> protocol as "shellfish serve",
+so a pipeline stage like "shellfish coord" can be swapped for
+"shellfish call coord" and transparently reuse the daemon's warm
+Environment instead of paying catalog/halo init costs again.`,
+}
+
+func init() {
+	callCmd.PersistentFlags().StringVar(
+		&callServer, "server", "http://localhost:7019",
+		"address of the `shellfish serve` daemon to call",
+	)
+	for name, mode := range cmd.ModeNames {
+		callCmd.AddCommand(newCallModeCommand(name, mode))
+	}
+	rootCmd.AddCommand(callCmd)
+}
+
+// newCallModeCommand mirrors newModeCommand, but posts to a daemon
+// instead of running the mode in-process.
+func newCallModeCommand(name string, mode cmd.Mode) *cobra.Command {
+	c := &cobra.Command{
+		Use:   name + " [" + name + ".config]",
+		Short: "Call the " + name + " mode on a warm daemon",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return callMode(c, name, args)
+		},
+		ValidArgsFunction: configFileCompletion(name),
+	}
+	fields := parseExampleConfig(mode.ExampleConfig())
+	registerConfigFlags(c.Flags(), fields)
+	registerEnumCompletions(c, fields)
+	return c
+}
+
+func callMode(c *cobra.Command, name string, args []string) error {
+	var lines []string
+	if pipelineModes[name] {
+		var err error
+		lines, err = stdinLines()
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return nil
+		} else if len(lines) == 1 && len(lines[0]) >= 9 &&
+			lines[0][:9] == "Shellfish" {
+			fmt.Println(lines[0])
+			return fmt.Errorf("upstream stage failed")
+		}
+	}
+
+	flags := map[string]string{}
+	if len(args) == 1 {
+		fileFlags, err := readConfigFileFlags(args[0])
+		if err != nil {
+			return err
+		}
+		for name, value := range fileFlags {
+			flags[name] = value
+		}
+	}
+
+	// Flags passed explicitly on the command line win over the config
+	// file, matching "If you supply both a config file and flags..." in
+	// modeDescriptions.
+	c.Flags().Visit(func(f *pflag.Flag) {
+		flags[f.Name] = flagValueString(c.Flags(), f)
+	})
+
+	body, err := json.Marshal(modeRequest{Flags: flags, Catalog: lines})
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(
+		callServer+"/v1/"+name, "application/json", bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var out modeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	if out.Error != "" {
+		return fmt.Errorf(out.Error)
+	}
+
+	for i := range out.Catalog {
+		fmt.Println(out.Catalog[i])
+	}
+	return nil
+}
+
+// readConfigFileFlags reads a mode-specific config file and turns its
+// variables into the same flags-map form that --flag overrides use, so
+// that "shellfish call <mode> some.config" forwards the file's contents
+// to the daemon the same way "shellfish <mode> some.config" would have
+// applied it locally via mode.ReadConfig.
+func readConfigFileFlags(path string) (map[string]string, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := parseExampleConfig(string(bs))
+	flags := make(map[string]string, len(fields))
+	for _, field := range fields {
+		flags[field.Name] = field.Default
+	}
+	return flags, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/phil-mansfield/shellfish/cmd"
+)
+
+var gendocCmd = &cobra.Command{
+	Use:    "gendoc <dir>",
+	Short:  "Generate markdown reference docs from the mode registry",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	RunE: func(c *cobra.Command, args []string) error {
+		return gendoc(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gendocCmd)
+}
+
+// gendoc walks cmd.ModeNames and the GlobalConfig, writing one reference
+// doc per mode into dir so the tutorial and website can't drift from the
+// code the way the "documented in version 1.0" stubs did.
+func gendoc(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := writeModeDoc(
+		dir, "config", "Global config", "",
+		new(cmd.GlobalConfig).ExampleConfig(),
+	); err != nil {
+		return err
+	}
+
+	for name, mode := range cmd.ModeNames {
+		err := writeModeDoc(
+			dir, name, name, helpStrings[name], mode.ExampleConfig(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeModeDoc renders a single mode's markdown page: front-matter,
+// a Synopsis section taken from its help string, an Options section
+// listing every field parsed out of its example config, and an Example
+// config section with the raw ExampleConfig() text.
+func writeModeDoc(dir, name, title, synopsis, exampleConfig string) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "---\ntitle: %s\n---\n\n", title)
+
+	fmt.Fprintf(&b, "## Synopsis\n\n")
+	if synopsis == "" {
+		fmt.Fprintf(&b, "No synopsis is available for this mode yet.\n\n")
+	} else {
+		fmt.Fprintf(&b, "%s\n\n", synopsis)
+	}
+
+	fmt.Fprintf(&b, "## Options\n\n")
+	fields := parseExampleConfig(exampleConfig)
+	if len(fields) == 0 {
+		fmt.Fprintf(&b, "This mode takes no configuration variables.\n\n")
+	} else {
+		fmt.Fprintf(&b, "| Variable | Default | Description |\n")
+		fmt.Fprintf(&b, "| --- | --- | --- |\n")
+		for _, field := range fields {
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s |\n",
+				field.Name, field.Default, field.Comment,
+			)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+
+	fmt.Fprintf(&b, "## Example config\n\n```\n%s\n```\n", exampleConfig)
+
+	return os.WriteFile(
+		filepath.Join(dir, name+".md"), []byte(b.String()), 0644,
+	)
+}
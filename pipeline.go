@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+
+	"github.com/phil-mansfield/shellfish/cmd"
+	"github.com/phil-mansfield/shellfish/cmd/env"
+)
+
+var pipelineDryRun bool
+
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline <pipeline.config>",
+	Short: "Run a sequence of modes in-process, sharing one warm Environment",
+	Long: `pipeline reads an ordered list of stages from a TOML config file
+and threads the []string catalog output of each stage directly into
+mode.Run of the next, all inside a single process against one
+env.Environment. This avoids the text (de)serialization and repeated
+initCatalogs/initHalos/memo-check cost that chaining modes with shell
+pipes pays on every stage.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(c *cobra.Command, args []string) error {
+		return runPipeline(args[0], pipelineDryRun)
+	},
+}
+
+func init() {
+	pipelineCmd.Flags().BoolVar(
+		&pipelineDryRun, "dry-run", false,
+		"print the resolved stage plan instead of running it",
+	)
+	rootCmd.AddCommand(pipelineCmd)
+}
+
+// pipelineFile is the TOML shape of a pipeline config: an ordered list of
+// stages, each naming a mode and its own mode-specific config file.
+type pipelineFile struct {
+	Stage []pipelineStage `toml:"stage"`
+}
+
+// pipelineStage is one step of a pipeline: which mode to run, which
+// mode-specific config file to read it from, an optional guard (the
+// stage is skipped if the named environment variable is unset, empty,
+// "0" or "false"), and an optional file to also write the stage's output catalog
+// to, in addition to threading it into the next stage.
+type pipelineStage struct {
+	Mode   string `toml:"mode"`
+	Config string `toml:"config"`
+	If     string `toml:"if"`
+	Output string `toml:"output"`
+}
+
+// runPipeline resolves the stage plan, then either prints it (--dry-run)
+// or executes it against a single shared Environment.
+func runPipeline(path string, dryRun bool) error {
+	var file pipelineFile
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return err
+	}
+
+	plan, err := resolvePipelinePlan(file)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		for _, stage := range plan {
+			fmt.Printf(
+				"%s\t%s\t-> %s\n", stage.Mode, stage.Config, outputLabel(stage.Output),
+			)
+		}
+		return nil
+	}
+
+	gConfigName, gConfig, err := resolveGlobalConfig()
+	if err != nil {
+		return err
+	}
+	if err := checkMemoDir(gConfig.MemoDir, gConfigName); err != nil {
+		return err
+	}
+
+	e := &env.Environment{MemoDir: gConfig.MemoDir}
+	if err := initCatalogs(gConfig, e); err != nil {
+		return err
+	}
+
+	// Warm the halo catalog at most once for the whole pipeline, the same
+	// way serve.go warms it once for the whole daemon, instead of paying
+	// its init cost again every time a later stage also happens to need
+	// it (e.g. an "id" stage followed by a "coord" stage).
+	for _, stage := range plan {
+		switch stage.Mode {
+		case "shell", "stats", "prof":
+			continue
+		}
+		if err := initHalos(stage.Mode, gConfig, e); err != nil {
+			return err
+		}
+		break
+	}
+
+	var catalog []string
+	for _, stage := range plan {
+		mode, ok := cmd.ModeNames[stage.Mode]
+		if !ok {
+			return fmt.Errorf("pipeline stage names unknown mode '%s'", stage.Mode)
+		}
+
+		if err := mode.ReadConfig(stage.Config); err != nil {
+			return err
+		}
+
+		catalog, err = mode.Run(nil, gConfig, e, catalog)
+		if err != nil {
+			return err
+		}
+
+		if stage.Output != "" {
+			if err := writeCatalogFile(stage.Output, catalog); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range catalog {
+		fmt.Println(catalog[i])
+	}
+	return nil
+}
+
+// resolvePipelinePlan drops every stage whose "if" guard isn't set, so
+// --dry-run shows exactly the stages that would actually run.
+func resolvePipelinePlan(file pipelineFile) ([]pipelineStage, error) {
+	var plan []pipelineStage
+	for _, stage := range file.Stage {
+		if stage.Mode == "" {
+			return nil, fmt.Errorf("pipeline stage is missing a 'mode'")
+		}
+		if stage.If != "" {
+			val := os.Getenv(stage.If)
+			if val == "" || val == "0" || val == "false" {
+				continue
+			}
+		}
+		plan = append(plan, stage)
+	}
+	return plan, nil
+}
+
+func outputLabel(output string) string {
+	if output == "" {
+		return "(next stage)"
+	}
+	return output
+}
+
+func writeCatalogFile(path string, catalog []string) error {
+	var text string
+	for i := range catalog {
+		text += catalog[i] + "\n"
+	}
+	return ioutil.WriteFile(path, []byte(text), 0644)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/phil-mansfield/shellfish/cmd"
+	"github.com/phil-mansfield/shellfish/cmd/env"
+	"github.com/phil-mansfield/shellfish/version"
+)
+
+// pipelineModes is the set of modes that read a catalog from stdin and
+// write one to stdout, as opposed to "id", which generates its own
+// catalog from scratch.
+var pipelineModes = map[string]bool{
+	"tree": true, "coord": true, "prof": true, "shell": true, "stats": true,
+}
+
+var globalConfigFile string
+
+// rootCmd is the top-level Shellfish command. Every mode subcommand, plus
+// the bookkeeping commands below, is attached to it in init().
+var rootCmd = &cobra.Command{
+	Use:           "shellfish",
+	Short:         "Shellfish computes the splashback shells of halos in N-body simulations.",
+	Long:          modeDescriptions,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+var versionJSON bool
+var versionShort bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the Shellfish version",
+	Run: func(cmd *cobra.Command, args []string) {
+		printVersion(versionJSON, versionShort)
+	},
+}
+
+// printVersion writes the build identity in one of three forms: the
+// default human-readable line, --short (just the version number), or
+// --json (machine-readable, for tooling that wraps the binary).
+func printVersion(asJSON, short bool) {
+	switch {
+	case asJSON:
+		fmt.Printf(
+			`{"version":%q,"commit":%q,"built":%q,"go":%q}`+"\n",
+			version.Version, version.GitCommit, version.BuildDate, version.GoVersion,
+		)
+	case short:
+		fmt.Println(version.Version)
+	default:
+		fmt.Printf(
+			"Shellfish version %s (commit %s, built %s, %s)\n",
+			version.Version, version.GitCommit, version.BuildDate, version.GoVersion,
+		)
+	}
+}
+
+var helloCmd = &cobra.Command{
+	Use:   "hello",
+	Short: "Check that Shellfish was installed correctly",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Hello back at you! Installation was successful.\n")
+	},
+}
+
+// helpCmd replaces Cobra's built-in "help" command so that topics like
+// "id.config" or "config" - which aren't subcommands and so are never
+// found by Cobra's own lookup - still resolve to the matching entry in
+// helpStrings. Anything else falls back to Cobra's normal command help.
+var helpCmd = &cobra.Command{
+	Use:   "help [command or config topic]",
+	Short: "Help about any command, or a config-file topic",
+	Run: func(c *cobra.Command, args []string) {
+		if len(args) == 1 {
+			if text, ok := helpStrings[args[0]]; ok {
+				fmt.Println(text)
+				return
+			}
+		}
+
+		target, _, err := rootCmd.Find(args)
+		if err != nil || target == nil {
+			target = rootCmd
+		}
+		target.InitDefaultHelpFlag()
+		target.Help()
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(
+		&globalConfigFile, "global-config", "",
+		"Path to the global Shellfish config file. Overrides "+
+			"$SHELLFISH_GLOBAL_CONFIG.",
+	)
+	versionCmd.Flags().BoolVar(
+		&versionJSON, "json", false, "print version info as JSON",
+	)
+	versionCmd.Flags().BoolVar(
+		&versionShort, "short", false, "print only the version number",
+	)
+
+	for name := range cmd.ModeNames {
+		rootCmd.AddCommand(newModeCommand(name))
+	}
+	rootCmd.AddCommand(versionCmd, helloCmd, helpCmd)
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		fmt.Println("Shellfish terminating.")
+		os.Exit(1)
+	}
+}
+
+// newModeCommand builds the cobra.Command for a single Shellfish mode,
+// registering one pflag per variable in the mode's ExampleConfig() and
+// wiring its Run to the same stdin -> stdout pipeline that main() used to
+// drive by hand.
+func newModeCommand(name string) *cobra.Command {
+	mode := cmd.ModeNames[name]
+
+	c := &cobra.Command{
+		Use:   name + " [" + name + ".config]",
+		Short: shortHelp(name),
+		Long:  helpStrings[name],
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runMode(c, name, mode, args)
+		},
+		ValidArgsFunction: configFileCompletion(name),
+	}
+
+	fields := parseExampleConfig(mode.ExampleConfig())
+	registerConfigFlags(c.Flags(), fields)
+	registerEnumCompletions(c, fields)
+
+	return c
+}
+
+func shortHelp(name string) string {
+	if text, ok := helpStrings[name]; ok {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			return text[:i]
+		}
+		return text
+	}
+	return "Run the " + name + " mode"
+}
+
+// runMode reproduces the body of the historical argv-based main(): it
+// reads the global config, checks the memo directory, initializes the
+// catalogs/halos, and pipes stdin through mode.Run to stdout.
+func runMode(c *cobra.Command, name string, mode cmd.Mode, args []string) error {
+	var lines []string
+	if pipelineModes[name] {
+		var err error
+		lines, err = stdinLines()
+		if err != nil {
+			return err
+		}
+
+		if len(lines) == 0 {
+			return nil
+		} else if len(lines) == 1 && len(lines[0]) >= 9 &&
+			lines[0][:9] == "Shellfish" {
+			fmt.Println(lines[0])
+			return fmt.Errorf("upstream stage failed")
+		}
+	}
+
+	flags := changedFlagTokens(c.Flags())
+
+	if len(args) == 1 {
+		if err := mode.ReadConfig(args[0]); err != nil {
+			return err
+		}
+	} else {
+		if err := mode.ReadConfig(""); err != nil {
+			return err
+		}
+	}
+
+	gConfigName, gConfig, err := resolveGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := checkMemoDir(gConfig.MemoDir, gConfigName); err != nil {
+		return err
+	}
+
+	e := &env.Environment{MemoDir: gConfig.MemoDir}
+	if err := initCatalogs(gConfig, e); err != nil {
+		return err
+	}
+	if err := initHalos(name, gConfig, e); err != nil {
+		return err
+	}
+
+	out, err := mode.Run(flags, gConfig, e, lines)
+	if err != nil {
+		return err
+	}
+
+	for i := range out {
+		fmt.Println(out[i])
+	}
+	return nil
+}
+
+// resolveGlobalConfig finds the global config file via --global-config,
+// falling back to $SHELLFISH_GLOBAL_CONFIG, and parses it.
+func resolveGlobalConfig() (string, *cmd.GlobalConfig, error) {
+	name := globalConfigFile
+	if name == "" {
+		name = os.Getenv("SHELLFISH_GLOBAL_CONFIG")
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("No global config file provided. Pass " +
+			"--global-config or set $SHELLFISH_GLOBAL_CONFIG.")
+	}
+
+	config := &cmd.GlobalConfig{}
+	if err := config.ReadConfig(name); err != nil {
+		return "", nil, err
+	}
+	return name, config, nil
+}
+
+// changedFlagTokens re-serializes every pflag that the user actually set
+// on the command line into the "--Name value" token form that
+// cmd.Mode.Run has always expected, so the mode package itself doesn't
+// need to know that Cobra exists.
+func changedFlagTokens(fs *pflag.FlagSet) []string {
+	var flags []string
+	fs.Visit(func(f *pflag.Flag) {
+		flags = append(flags, "--"+f.Name, flagValueString(fs, f))
+	})
+	return flags
+}
+
+// flagValueString returns a flag's value in the plain, comma-separated
+// form mode.Run expects. pflag.Value.String() wraps string slices as
+// "[a,b,c]", which would otherwise leak Cobra's internal representation
+// into --IDs "0, 1, 2" style values.
+func flagValueString(fs *pflag.FlagSet, f *pflag.Flag) string {
+	if f.Value.Type() == "stringSlice" {
+		vals, _ := fs.GetStringSlice(f.Name)
+		return strings.Join(vals, ",")
+	}
+	return f.Value.String()
+}
+
+// configField describes a single variable documented in a mode's
+// ExampleConfig() text, e.g. "IDType = M200m # the halo mass definition".
+type configField struct {
+	Name    string
+	Default string
+	Comment string
+}
+
+var exampleConfigLineRE = regexp.MustCompile(
+	`^\s*([A-Za-z][A-Za-z0-9_]*)\s*=\s*([^#]*?)\s*(?:#\s*(.*))?$`,
+)
+
+// parseExampleConfig extracts the variable names and default values out
+// of the human-readable text returned by a mode's ExampleConfig(), so
+// that the Cobra flags can be derived from it instead of being
+// hand-maintained twice.
+func parseExampleConfig(text string) []configField {
+	var fields []configField
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		m := exampleConfigLineRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		fields = append(fields, configField{
+			Name:    m[1],
+			Default: strings.Trim(m[2], `"`),
+			Comment: m[3],
+		})
+	}
+	return fields
+}
+
+// registerConfigFlags adds one pflag per configField, typed by sniffing
+// its default value: comma-separated lists become string slices,
+// integers and floats become their numeric pflag types, and everything
+// else becomes a plain string.
+func registerConfigFlags(fs *pflag.FlagSet, fields []configField) {
+	for _, field := range fields {
+		switch {
+		case strings.Contains(field.Default, ","):
+			vals := strings.Split(field.Default, ",")
+			for i := range vals {
+				vals[i] = strings.TrimSpace(vals[i])
+			}
+			fs.StringSlice(field.Name, vals, field.Comment)
+		case isInt(field.Default):
+			n, _ := strconv.ParseInt(field.Default, 10, 64)
+			fs.Int64(field.Name, n, field.Comment)
+		case isFloat(field.Default):
+			x, _ := strconv.ParseFloat(field.Default, 64)
+			fs.Float64(field.Name, x, field.Comment)
+		default:
+			fs.String(field.Name, field.Default, field.Comment)
+		}
+	}
+}
+
+func isInt(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+func isFloat(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
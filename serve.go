@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/phil-mansfield/shellfish/cmd"
+	"github.com/phil-mansfield/shellfish/cmd/env"
+)
+
+var serveAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a daemon that keeps a warm Environment and serves each mode over HTTP",
+	Long: `serve starts a long-lived process that initializes a single
+cmd/env.Environment from the global config (exactly once, the same way a
+pipeline invocation would) and exposes every mode in cmd.ModeNames as a
+JSON endpoint under /v1/<mode>. This avoids re-reading catalogs and
+rebuilding the memo directory index on every pipeline stage, which is
+expensive on large simulations. See "shellfish call" for the matching
+client.`,
+	Args: cobra.NoArgs,
+	RunE: func(c *cobra.Command, args []string) error {
+		return serve(serveAddr)
+	},
+}
+
+// modeRequest is the JSON body every /v1/<mode> endpoint accepts: the
+// mode's own config variables, expressed the same way they'd be passed
+// as flags, plus the "stdin" catalog it would otherwise have read from a
+// pipe.
+type modeRequest struct {
+	Flags   map[string]string `json:"flags"`
+	Catalog []string          `json:"catalog"`
+}
+
+// modeResponse is the JSON body every /v1/<mode> endpoint returns: the
+// equivalent of the catalog a pipeline invocation would print to stdout.
+type modeResponse struct {
+	Catalog []string `json:"catalog"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func init() {
+	serveCmd.Flags().StringVar(
+		&serveAddr, "addr", ":7019", "address to listen on",
+	)
+	rootCmd.AddCommand(serveCmd)
+}
+
+// serve initializes one warm Environment and serves it to every mode
+// endpoint for the lifetime of the process.
+func serve(addr string) error {
+	gConfigName, gConfig, err := resolveGlobalConfig()
+	if err != nil {
+		return err
+	}
+	if err := checkMemoDir(gConfig.MemoDir, gConfigName); err != nil {
+		return err
+	}
+
+	e := &env.Environment{MemoDir: gConfig.MemoDir}
+	if err := initCatalogs(gConfig, e); err != nil {
+		return err
+	}
+
+	// Warm the halo catalog once, up front, the same way initCatalogs was
+	// just warmed above - this is the whole point of the daemon. "id" is
+	// used as the representative mode here only to pick a non-skipped
+	// branch of initHalos; the halo catalog it loads is shared by every
+	// mode. A deployment that only ever serves halo-free modes (shell,
+	// stats, prof) won't have HaloType configured, so a failure here is
+	// logged rather than fatal, and that deployment's requests are none
+	// the worse for it.
+	if err := initHalos("id", gConfig, e); err != nil {
+		log.Printf("halo catalog not warmed at startup: %s\n", err.Error())
+	}
+
+	mux := http.NewServeMux()
+	for name, mode := range cmd.ModeNames {
+		mux.HandleFunc("/v1/"+name, serveModeHandler(name, mode, gConfig, e))
+	}
+
+	fmt.Printf("Shellfish serving on %s\n", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// serveModeHandler builds the /v1/<mode> handler for a single mode,
+// reusing the warm gConfig/Environment across every request it serves.
+// Because net/http runs each request on its own goroutine but
+// cmd.ModeNames hands out a single shared Mode instance per name, a
+// mutex serializes ReadConfig+Run for a given mode so two concurrent
+// requests to the same endpoint can't clobber each other's flags.
+func serveModeHandler(
+	name string, mode cmd.Mode, gConfig *cmd.GlobalConfig, e *env.Environment,
+) http.HandlerFunc {
+	var mu sync.Mutex
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req modeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeModeResponse(w, modeResponse{Error: err.Error()})
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err := mode.ReadConfig(""); err != nil {
+			writeModeResponse(w, modeResponse{Error: err.Error()})
+			return
+		}
+
+		out, err := mode.Run(flagMapToTokens(req.Flags), gConfig, e, req.Catalog)
+		if err != nil {
+			writeModeResponse(w, modeResponse{Error: err.Error()})
+			return
+		}
+		writeModeResponse(w, modeResponse{Catalog: out})
+	}
+}
+
+func writeModeResponse(w http.ResponseWriter, resp modeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// flagMapToTokens turns the JSON flag map back into the "--Name value"
+// token form that cmd.Mode.Run has always expected.
+func flagMapToTokens(flags map[string]string) []string {
+	var tokens []string
+	for name, value := range flags {
+		tokens = append(tokens, "--"+name, value)
+	}
+	return tokens
+}
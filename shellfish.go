@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path"
 	"strings"
@@ -42,7 +41,7 @@ Column 1 - Snap: Index of the halo's snapshot`,
 
 	"tree":  `Mode specifcations will be documented in version 1.0.`,
 	"coord": `Mode specifcations will be documented in version 1.0.`,
-	"prof": `Mode specifcations will be documented in version 1.0.`,
+	"prof":  `Mode specifcations will be documented in version 1.0.`,
 	"shell": `Mode specifcations will be documented in version 1.0.`,
 	"stats": `Mode specifcations will be documented in version 1.0.`,
 
@@ -83,8 +82,9 @@ For documented example config files, type any of:
 
 In addition to any arguments passed at the command line, before calling
 Shellfish rountines you will need to specify a "global" config file (it
-has the file ending ".config"). Do this by setting the $SHELLFISH_GLOBAL_CONFIG
-environment variable. For a documented global config file, type
+has the file ending ".config"). Do this with the --global-config flag, or
+by setting the $SHELLFISH_GLOBAL_CONFIG environment variable. For a
+documented global config file, type
 
     shellfish help config
 
@@ -93,135 +93,13 @@ output catalog through standard out. (The only exception is the id tool, which
 doesn't take any input thorugh stdin) This means that you will generally invoke
 shellfish as a series of piped commands. E.g:
 
-    shellfish id example.id.config | shellfish coord | shellfish shell    
+    shellfish id example.id.config | shellfish coord | shellfish shell
 
 For more information on the input and output that a given tool expects, type
 any of:
 
     shellfish help [ id | tree | coord | prof | shell | stats ]`
 
-func main() {
-	args := os.Args
-	if len(args) <= 1 {
-		fmt.Fprintf(
-			os.Stderr, "I was not supplied with a mode.\nFor help, type "+
-				"'./shellfish help'.\n",
-		)
-		os.Exit(1)
-	}
-
-	switch args[1] {
-	case "help":
-		switch len(args) - 2 {
-		case 0:
-			fmt.Println(modeDescriptions)
-		case 1:
-			text, ok := helpStrings[args[2]]
-			if !ok {
-				fmt.Printf("I don't recognize the help target '%s'\n", args[2])
-			} else {
-				fmt.Println(text)
-			}
-		case 2:
-			fmt.Println("The help mode can only take a single argument.")
-		}
-		os.Exit(0)
-		// TODO: Implement the help command.
-	case "version":
-		fmt.Printf("Shellfish version %s\n", version.SourceVersion)
-		os.Exit(0)
-	case "hello":
-		fmt.Printf("Hello back at you! Installation was successful.\n")
-		os.Exit(0)
-	}
-
-	mode, ok := cmd.ModeNames[args[1]]
-	
-	if !ok {
-		fmt.Fprintf(
-			os.Stderr, "You passed me the mode '%s', which I don't "+
-				"recognize.\nFor help, type './shellfish help'\n", args[1],
-		)
-		fmt.Println("Shellfish terminating.")
-		os.Exit(1)
-	}
-
-	var lines []string
-	switch args[1] {
-	case "tree", "coord", "prof", "shell", "stats":
-		var err error
-		lines, err = stdinLines()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, err.Error())
-			fmt.Println("Shellfish terminating.")
-			os.Exit(1)
-		}
-
-		if len(lines) == 0 {
-			return
-		} else if len(lines) == 1 && len(lines[0]) >= 9 &&
-			lines[0][:9] == "Shellfish" {
-			fmt.Println(lines[0])
-			os.Exit(1)
-		}
-	}
-	
-	flags := getFlags(args)
-	config, ok := getConfig(args)
-	gConfigName, gConfig, err := getGlobalConfig(args)
-	if err != nil {
-		log.Printf("Error running mode %s:\n%s\n", args[1], err.Error())
-		fmt.Println("Shellfish terminating.")
-		os.Exit(1)
-	}
-	
-	if ok {
-		if err = mode.ReadConfig(config); err != nil {
-			log.Printf("Error running mode %s:\n%s\n", args[1], err.Error())
-			fmt.Println("Shellfish terminating.")
-			os.Exit(1)
-		}
-	} else {
-		if err = mode.ReadConfig(""); err != nil {
-			log.Printf("Error running mode %s:\n%s\n", args[1], err.Error())
-			fmt.Println("Shellfish terminating.")
-			os.Exit(1)
-		}
-	}
-
-	if err = checkMemoDir(gConfig.MemoDir, gConfigName); err != nil {
-		log.Printf("Error running mode %s:\n%s\n", args[1], err.Error())
-		fmt.Println("Shellfish terminating.")
-		os.Exit(1)
-	}
-	
-	e := &env.Environment{MemoDir: gConfig.MemoDir}
-	err = initCatalogs(gConfig, e)
-	if err != nil {
-		log.Printf("Error running mode %s:\n%s\n", args[1], err.Error())
-		fmt.Println("Shellfish terminating.")
-		os.Exit(1)
-	}
-	
-	err = initHalos(args[1], gConfig, e)
-	if err != nil {
-		log.Printf("Error running mode %s:\n%s\n", args[1], err.Error())
-		fmt.Println("Shellfish terminating.")
-		os.Exit(1)
-	}
-	
-	out, err := mode.Run(flags, gConfig, e, lines)
-	if err != nil {
-		log.Printf("Error running mode %s:\n%s\n", args[1], err.Error())
-		fmt.Println("Shellfish terminating.")
-		os.Exit(1)
-	}
-
-	for i := range out {
-		fmt.Println(out[i])
-	}
-}
-
 // stdinLines reads stdin and splits it into lines.
 func stdinLines() ([]string, error) {
 	bs, err := ioutil.ReadAll(os.Stdin)
@@ -238,93 +116,20 @@ func stdinLines() ([]string, error) {
 	return lines, nil
 }
 
-// getFlags reutrns the flag tokens from the command line arguments.
-func getFlags(args []string) []string {
-	return args[1 : len(args)-1-configNum(args)]
-}
-
-// getGlobalConfig returns the name of the base config file from the command
-// line arguments.
-func getGlobalConfig(args []string) (string, *cmd.GlobalConfig, error) {
-	name := os.Getenv("SHELLFISH_GLOBAL_CONFIG")
-	if name != "" {
-		if configNum(args) > 1 {
-			return "", nil, fmt.Errorf("$SHELLFISH_GLOBAL_CONFIG has been " +
-				"set, so you may only pass a single config file as a " +
-				"parameter.")
-		}
-
-		config := &cmd.GlobalConfig{}
-		err := config.ReadConfig(name)
-		if err != nil {
-			return "", nil, err
-		}
-		return name, config, nil
-	}
-
-	switch configNum(args) {
-	case 0:
-		return "", nil, fmt.Errorf("No config files provided in command " +
-			"line arguments.")
-	case 1:
-		name = args[len(args)-1]
-	case 2:
-		name = args[len(args)-2]
-	default:
-		return "", nil, fmt.Errorf("Passed too many config files as arguments.")
-	}
-
-	config := &cmd.GlobalConfig{}
-	err := config.ReadConfig(name)
-	if err != nil {
-		return "", nil, err
-	}
-	return name, config, nil
-}
-
-// getConfig return the name of the mode-specific config file from the command
-// line arguments.
-func getConfig(args []string) (string, bool) {
-	if os.Getenv("SHELLFISH_GLOBAL_CONFIG") != "" && configNum(args) == 1 {
-		return args[len(args)-1], true
-	} else if os.Getenv("SHELLFISH_GLOBAL_CONFIG") == "" &&
-		configNum(args) == 2 {
-
-		return args[len(args)-1], true
-	}
-	return "", false
-}
-
-// configNum returns the number of configuration files at the end of the
-// argument list (up to 2).
-func configNum(args []string) int {
-	num := 0
-	for i := len(args) - 1; i >= 0; i-- {
-		if isConfig(args[i]) {
-			num++
-		} else {
-			break
-		}
-	}
-	return num
-}
-
-// isConfig returns true if the fiven string is a config file name.
-func isConfig(s string) bool {
-	return len(s) >= 7 && s[len(s)-7:] == ".config"
-}
-
 // cehckMemoDir checks whether the given MemoDir corresponds to a GlobalConfig
-// file with the exact same variables. If not, a non-nil error is returned.
-// If the MemoDir does not have an associated GlobalConfig file, the current
-// one will be copied in.
+// file with the exact same variables, and to the same Shellfish build that
+// created it. If not, a non-nil error is returned. If the MemoDir does not
+// have an associated GlobalConfig file, the current one will be copied in.
 func checkMemoDir(memoDir, configFile string) error {
 	memoConfigFile := path.Join(memoDir, "memo.config")
+	memoVersionFile := path.Join(memoDir, "memo.version")
 
 	if _, err := os.Stat(memoConfigFile); err != nil {
 		// File doesn't exist, directory is clean.
-		err = copyFile(memoConfigFile, configFile)
-		return err
+		if err := copyFile(memoConfigFile, configFile); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(memoVersionFile, []byte(version.Version), 0644)
 	}
 
 	config, memoConfig := &cmd.GlobalConfig{}, &cmd.GlobalConfig{}
@@ -334,8 +139,19 @@ func checkMemoDir(memoDir, configFile string) error {
 	if err := memoConfig.ReadConfig(memoConfigFile); err != nil {
 		return err
 	}
+	memoVersion, err := readMemoVersion(memoVersionFile)
+	if err != nil {
+		return err
+	}
 
-	if !configEqual(config, memoConfig) {
+	if !configEqual(config, memoConfig, memoVersion) {
+		if memoVersion != version.Version {
+			return fmt.Errorf("The MemoDir '%s' was created by Shellfish %s, "+
+				"but this binary is Shellfish %s. Delete the MemoDir (or "+
+				"point MemoDir at a fresh directory) before reusing it with "+
+				"the new version.", memoDir, memoVersion, version.Version,
+			)
+		}
 		return fmt.Errorf("The variables in the config file '%s' do not "+
 			"match the varables used when creating the MemoDir, '%s.' These "+
 			"variables can be compared by inspecting '%s' and '%s'",
@@ -345,6 +161,23 @@ func checkMemoDir(memoDir, configFile string) error {
 	return nil
 }
 
+// readMemoVersion returns the Shellfish build version that created
+// memoDir. MemoDirs created before this check existed won't have a
+// memo.version file; those are assumed to match and backfilled so later
+// runs can be checked properly.
+func readMemoVersion(memoVersionFile string) (string, error) {
+	bs, err := ioutil.ReadFile(memoVersionFile)
+	if err == nil {
+		return string(bs), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	return version.Version, ioutil.WriteFile(
+		memoVersionFile, []byte(version.Version), 0644,
+	)
+}
+
 // copyFile copies a file from src to dst.
 func copyFile(dst, src string) error {
 	srcFile, err := os.Open(src)
@@ -365,11 +198,18 @@ func copyFile(dst, src string) error {
 	return dstFile.Sync()
 }
 
-func configEqual(m, c *cmd.GlobalConfig) bool {
+func configEqual(m, c *cmd.GlobalConfig, memoVersion string) bool {
 	// Well, equal up to the variables that actually matter.
 	// (i.e. changing something like Threads shouldn't flush the memoization
 	// buffer. Otherwise, I'd just use reflection.)
-	return c.Version == m.Version &&
+	//
+	// The Shellfish build itself is one of those variables: an upgrade can
+	// change how the memoized data on disk is interpreted just as much as
+	// a changed config variable can, so memoVersion is checked here too
+	// instead of being a separate, parallel notion of "does this MemoDir
+	// still apply."
+	return memoVersion == version.Version &&
+		c.Version == m.Version &&
 		c.SnapshotFormat == m.SnapshotFormat &&
 		c.SnapshotType == m.SnapshotType &&
 		c.HaloDir == m.HaloDir &&
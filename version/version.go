@@ -0,0 +1,24 @@
+// Package version reports the build identity of the Shellfish binary.
+// Version, GitCommit, and BuildDate are populated at build time via
+// -ldflags, e.g.:
+//
+//	go build -ldflags "\
+//	  -X github.com/phil-mansfield/shellfish/version.Version=$(git describe --tags --always) \
+//	  -X github.com/phil-mansfield/shellfish/version.GitCommit=$(git rev-parse HEAD) \
+//	  -X github.com/phil-mansfield/shellfish/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Any var left unset by the build keeps its placeholder default below.
+package version
+
+import "runtime"
+
+var (
+	// Version is the human-readable release version, e.g. "v0.3.1".
+	Version = "dev"
+	// GitCommit is the commit the binary was built from.
+	GitCommit = "unknown"
+	// BuildDate is when the binary was built, in RFC3339.
+	BuildDate = "unknown"
+	// GoVersion is the toolchain the binary was built with.
+	GoVersion = runtime.Version()
+)